@@ -0,0 +1,167 @@
+package usvc
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// HealthCheck reports an error if the thing it checks is unhealthy.
+type HealthCheck func(ctx context.Context) error
+
+type checkResult struct {
+	Name    string    `json:"name"`
+	Pass    bool      `json:"pass"`
+	LastRun time.Time `json:"lastRun"`
+	Error   string    `json:"error,omitempty"`
+}
+
+type registeredCheck struct {
+	check  HealthCheck
+	result checkResult
+}
+
+// Health is a registry of named liveness and readiness checks,
+// modeled on the health subsystem used by dex (github.com/dexidp/dex).
+// Checks run on every request by default; set an interval with NewHealth
+// to instead cache results and only re-run a check once it goes stale.
+type Health struct {
+	interval time.Duration
+
+	mu        sync.Mutex
+	liveness  map[string]*registeredCheck
+	readiness map[string]*registeredCheck
+
+	grpcHealth  *health.Server
+	grpcService string
+}
+
+// NewHealth returns an empty Health registry. An interval of 0 runs every
+// check on every request to /livez or /readyz; a positive interval instead
+// caches each check's result and only re-runs it once it's older than interval.
+func NewHealth(interval time.Duration) *Health {
+	return &Health{
+		interval:  interval,
+		liveness:  make(map[string]*registeredCheck),
+		readiness: make(map[string]*registeredCheck),
+	}
+}
+
+// RegisterLivenessCheck adds a named check reported on /livez.
+func (h *Health) RegisterLivenessCheck(name string, check HealthCheck) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.liveness[name] = &registeredCheck{check: check}
+}
+
+// RegisterReadinessCheck adds a named check reported on /readyz.
+func (h *Health) RegisterReadinessCheck(name string, check HealthCheck) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.readiness[name] = &registeredCheck{check: check}
+}
+
+// SetGRPCHealth wires the readiness aggregate to service on hs, so that it
+// reports SERVING/NOT_SERVING in lockstep with /readyz. hs is typically the
+// Server created by WithGRPCHealth, or the one registered by Conf.Server.
+func (h *Health) SetGRPCHealth(hs *health.Server, service string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.grpcHealth = hs
+	h.grpcService = service
+}
+
+func (h *Health) livezHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		h.serve(w, r, h.liveness, false)
+	}
+}
+
+func (h *Health) readyzHandler() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		h.serve(w, r, h.readiness, true)
+	}
+}
+
+func (h *Health) serve(w http.ResponseWriter, r *http.Request, checks map[string]*registeredCheck, readiness bool) {
+	results, pass := h.run(r.Context(), checks)
+
+	if readiness {
+		h.mu.Lock()
+		if h.grpcHealth != nil {
+			status := healthStatus(pass)
+			h.grpcHealth.SetServingStatus(h.grpcService, status)
+		}
+		h.mu.Unlock()
+	}
+
+	verbose := r.URL.Query().Get("verbose") == "1"
+	body := struct {
+		Checks []checkResult `json:"checks,omitempty"`
+	}{}
+	if !pass || verbose {
+		body.Checks = results
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if pass {
+		w.WriteHeader(http.StatusOK)
+	} else {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(body)
+}
+
+func (h *Health) run(ctx context.Context, checks map[string]*registeredCheck) ([]checkResult, bool) {
+	h.mu.Lock()
+	names := make([]string, 0, len(checks))
+	for name := range checks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	h.mu.Unlock()
+
+	pass := true
+	results := make([]checkResult, 0, len(names))
+	for _, name := range names {
+		h.mu.Lock()
+		rc := checks[name]
+		stale := h.interval <= 0 || time.Since(rc.result.LastRun) >= h.interval
+		h.mu.Unlock()
+
+		if stale {
+			res := checkResult{Name: name, LastRun: time.Now()}
+			if err := rc.check(ctx); err != nil {
+				res.Error = err.Error()
+			} else {
+				res.Pass = true
+			}
+			h.mu.Lock()
+			rc.result = res
+			h.mu.Unlock()
+		}
+
+		h.mu.Lock()
+		res := rc.result
+		h.mu.Unlock()
+
+		if !res.Pass {
+			pass = false
+		}
+		results = append(results, res)
+	}
+	return results, pass
+}
+
+func healthStatus(pass bool) healthpb.HealthCheckResponse_ServingStatus {
+	if pass {
+		return healthpb.HealthCheckResponse_SERVING
+	}
+	return healthpb.HealthCheckResponse_NOT_SERVING
+}
@@ -0,0 +1,329 @@
+package usvc
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/tls"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/api/global"
+	export "go.opentelemetry.io/otel/sdk/export/trace"
+	"go.opentelemetry.io/otel/sdk/metric/controller/push"
+	"go.opentelemetry.io/otel/sdk/metric/processor/basic"
+	"go.opentelemetry.io/otel/sdk/metric/selector/simple"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+)
+
+// otlpMaxRetries bounds the number of retry attempts for a single export,
+// on top of the overall OTLPOpts.Timeout deadline.
+const otlpMaxRetries = 5
+
+// OTLPOpts configures an OTLP exporter for traces and metrics, as an
+// alternative to the Jaeger/Prometheus paths in TracerOpts and Conf.Server.
+type OTLPOpts struct {
+	Endpoint    string
+	Protocol    string // http, grpc
+	Compression string // gzip, none; applied by the http protocol only
+	Headers     string // k=v,k2=v2,...
+	Insecure    bool
+	Timeout     time.Duration
+}
+
+// Flags registers the -otel.* flags onto fs.
+func (o *OTLPOpts) Flags(fs *flag.FlagSet) {
+	fs.StringVar(&o.Endpoint, "otel.endpoint", "", "otlp collector endpoint, e.g. localhost:4317")
+	fs.StringVar(&o.Protocol, "otel.protocol", "grpc", "otlp exporter protocol: http, grpc")
+	fs.StringVar(&o.Compression, "otel.compression", "gzip", "otlp payload compression for otel.protocol=http: gzip, none")
+	fs.StringVar(&o.Headers, "otel.headers", "", "extra otlp request headers, k=v,k2=v2")
+	fs.BoolVar(&o.Insecure, "otel.insecure", false, "disable tls for the otlp connection")
+	fs.DurationVar(&o.Timeout, "otel.timeout", 10*time.Second, "otlp export timeout")
+}
+
+func (o OTLPOpts) headers() map[string]string {
+	h := make(map[string]string)
+	for _, kv := range strings.Split(o.Headers, ",") {
+		if kv == "" {
+			continue
+		}
+		parts := strings.SplitN(kv, "=", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		h[parts[0]] = parts[1]
+	}
+	return h
+}
+
+// Tracer installs a global tracer that batches spans to o.Endpoint.
+// Unlike TracerOpts.Tracer, which always talks to a Jaeger collector,
+// this sends OTLP over o.Protocol.
+func (o OTLPOpts) Tracer() (shutdown func() error, err error) {
+	transport, err := o.newTransport()
+	if err != nil {
+		return nil, err
+	}
+	exporter := &otlpSpanExporter{transport: transport}
+	tp, err := sdktrace.NewProvider(sdktrace.WithBatcher(exporter))
+	if err != nil {
+		return nil, err
+	}
+	global.SetTraceProvider(tp)
+	return func() error { return nil }, nil
+}
+
+// Meter installs a global meter that pushes a checkpoint to o.Endpoint
+// every period, in place of the Prometheus pull exporter used elsewhere.
+func (o OTLPOpts) Meter(period time.Duration) (shutdown func() error, err error) {
+	transport, err := o.newTransport()
+	if err != nil {
+		return nil, err
+	}
+	exporter := &otlpMetricExporter{transport: transport}
+	pusher := push.New(
+		basic.New(simple.NewWithExactDistribution(), exporter, basic.WithMemory(false)),
+		exporter,
+		push.WithPeriod(period),
+	)
+	global.SetMeterProvider(pusher.Provider())
+	pusher.Start()
+	return func() error { pusher.Stop(); return nil }, nil
+}
+
+// otlpTransport sends pre-marshaled OTLP protobuf request bodies to a
+// collector over either HTTP or gRPC.
+type otlpTransport interface {
+	exportTraces(ctx context.Context, req []byte) error
+	exportMetrics(ctx context.Context, req []byte) error
+}
+
+func (o OTLPOpts) newTransport() (otlpTransport, error) {
+	switch o.Protocol {
+	case "http":
+		return newOTLPHTTPClient(o), nil
+	case "grpc", "":
+		return newOTLPGRPCClient(o)
+	default:
+		return nil, fmt.Errorf("otlp: unknown protocol %q", o.Protocol)
+	}
+}
+
+// otlpHTTPClient implements otlpTransport over HTTP, gzipping the body
+// when configured and retrying transient failures with jittered
+// exponential backoff, honoring Retry-After when the collector sends one.
+type otlpHTTPClient struct {
+	client   *http.Client
+	endpoint string
+	gzip     bool
+	headers  map[string]string
+	timeout  time.Duration
+}
+
+func newOTLPHTTPClient(o OTLPOpts) *otlpHTTPClient {
+	endpoint := o.Endpoint
+	if !strings.Contains(endpoint, "://") {
+		scheme := "https"
+		if o.Insecure {
+			scheme = "http"
+		}
+		endpoint = scheme + "://" + endpoint
+	}
+	return &otlpHTTPClient{
+		client:   &http.Client{},
+		endpoint: strings.TrimSuffix(endpoint, "/"),
+		gzip:     o.Compression == "gzip",
+		headers:  o.headers(),
+		timeout:  o.Timeout,
+	}
+}
+
+func (c *otlpHTTPClient) exportTraces(ctx context.Context, req []byte) error {
+	return c.post(ctx, "/v1/traces", req)
+}
+
+func (c *otlpHTTPClient) exportMetrics(ctx context.Context, req []byte) error {
+	return c.post(ctx, "/v1/metrics", req)
+}
+
+func (c *otlpHTTPClient) post(ctx context.Context, path string, body []byte) error {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	payload, encoding := body, ""
+	if c.gzip {
+		var buf bytes.Buffer
+		gw := gzip.NewWriter(&buf)
+		if _, err := gw.Write(body); err != nil {
+			return err
+		}
+		if err := gw.Close(); err != nil {
+			return err
+		}
+		payload, encoding = buf.Bytes(), "gzip"
+	}
+
+	backoff := 500 * time.Millisecond
+	for attempt := 0; ; attempt++ {
+		req, err := http.NewRequest(http.MethodPost, c.endpoint+path, bytes.NewReader(payload))
+		if err != nil {
+			return err
+		}
+		req = req.WithContext(ctx)
+		req.Header.Set("Content-Type", "application/x-protobuf")
+		if encoding != "" {
+			req.Header.Set("Content-Encoding", encoding)
+		}
+		for k, v := range c.headers {
+			req.Header.Set(k, v)
+		}
+
+		resp, err := c.client.Do(req)
+		if err != nil {
+			if attempt >= otlpMaxRetries {
+				return err
+			}
+			if !sleep(ctx, jitter(backoff)) {
+				return ctx.Err()
+			}
+			backoff *= 2
+			continue
+		}
+		ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+
+		if resp.StatusCode/100 == 2 {
+			return nil
+		}
+		if !otlpRetryable(resp.StatusCode) {
+			return fmt.Errorf("otlp: %s: %s", path, resp.Status)
+		}
+		if attempt >= otlpMaxRetries {
+			return fmt.Errorf("otlp: %s: %s after %d attempts", path, resp.Status, attempt+1)
+		}
+
+		wait := jitter(backoff)
+		if ra := resp.Header.Get("Retry-After"); ra != "" {
+			if secs, err := strconv.Atoi(ra); err == nil {
+				wait = time.Duration(secs) * time.Second
+			} else if t, err := http.ParseTime(ra); err == nil {
+				wait = time.Until(t)
+			}
+		}
+		if !sleep(ctx, wait) {
+			return ctx.Err()
+		}
+		backoff *= 2
+	}
+}
+
+func otlpRetryable(code int) bool {
+	switch code {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// jitter returns a duration in [d/2, d], to avoid a thundering herd of
+// retries all landing on the collector at once.
+func jitter(d time.Duration) time.Duration {
+	return d/2 + time.Duration(rand.Int63n(int64(d/2+1)))
+}
+
+func sleep(ctx context.Context, d time.Duration) bool {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// otlpGRPCClient implements otlpTransport over gRPC, calling the
+// collector's TraceService/MetricsService Export RPCs with a codec that
+// passes our pre-marshaled protobuf bytes through unchanged.
+type otlpGRPCClient struct {
+	conn    *grpc.ClientConn
+	headers map[string]string
+	timeout time.Duration
+}
+
+func newOTLPGRPCClient(o OTLPOpts) (*otlpGRPCClient, error) {
+	var opts []grpc.DialOption
+	if o.Insecure {
+		opts = append(opts, grpc.WithInsecure())
+	} else {
+		opts = append(opts, grpc.WithTransportCredentials(credentials.NewTLS(&tls.Config{})))
+	}
+	conn, err := grpc.Dial(o.Endpoint, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return &otlpGRPCClient{conn: conn, headers: o.headers(), timeout: o.Timeout}, nil
+}
+
+func (c *otlpGRPCClient) exportTraces(ctx context.Context, req []byte) error {
+	return c.invoke(ctx, "/opentelemetry.proto.collector.trace.v1.TraceService/Export", req)
+}
+
+func (c *otlpGRPCClient) exportMetrics(ctx context.Context, req []byte) error {
+	return c.invoke(ctx, "/opentelemetry.proto.collector.metrics.v1.MetricsService/Export", req)
+}
+
+func (c *otlpGRPCClient) invoke(ctx context.Context, method string, req []byte) error {
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+	if len(c.headers) > 0 {
+		md := metadata.New(c.headers)
+		ctx = metadata.NewOutgoingContext(ctx, md)
+	}
+	var resp []byte
+	return c.conn.Invoke(ctx, method, &req, &resp, grpc.ForceCodec(rawBytesCodec{}))
+}
+
+// rawBytesCodec marshals/unmarshals *[]byte as-is, letting otlpGRPCClient
+// call Invoke with already-encoded protobuf bytes instead of generated
+// message types.
+type rawBytesCodec struct{}
+
+func (rawBytesCodec) Marshal(v interface{}) ([]byte, error) {
+	b, ok := v.(*[]byte)
+	if !ok {
+		return nil, fmt.Errorf("otlp: codec cannot marshal %T", v)
+	}
+	return *b, nil
+}
+
+func (rawBytesCodec) Unmarshal(data []byte, v interface{}) error {
+	b, ok := v.(*[]byte)
+	if !ok {
+		return fmt.Errorf("otlp: codec cannot unmarshal into %T", v)
+	}
+	*b = append((*b)[:0], data...)
+	return nil
+}
+
+func (rawBytesCodec) Name() string { return "proto" }
+
+// otlpSpanExporter implements export/trace.SpanBatcher over an otlpTransport.
+type otlpSpanExporter struct {
+	transport otlpTransport
+}
+
+func (e *otlpSpanExporter) ExportSpans(ctx context.Context, spans []*export.SpanData) {
+	if err := e.transport.exportTraces(ctx, marshalTraceRequest(spans)); err != nil {
+		global.Handle(err)
+	}
+}
@@ -0,0 +1,81 @@
+package usvc
+
+import (
+	"context"
+
+	apimetric "go.opentelemetry.io/otel/api/metric"
+	metricsdk "go.opentelemetry.io/otel/sdk/export/metric"
+	"go.opentelemetry.io/otel/sdk/export/metric/aggregation"
+)
+
+// otlpMetricExporter implements sdk/export/metric.Exporter over an
+// otlpTransport, supporting Sum (Counter) and LastValue (ValueObserver)
+// aggregations; other kinds are skipped rather than failing the export.
+type otlpMetricExporter struct {
+	transport otlpTransport
+}
+
+func (e *otlpMetricExporter) ExportKindFor(*apimetric.Descriptor, aggregation.Kind) metricsdk.ExportKind {
+	return metricsdk.CumulativeExporter
+}
+
+func (e *otlpMetricExporter) Export(ctx context.Context, cs metricsdk.CheckpointSet) error {
+	var points []otlpNumberPoint
+	err := cs.ForEach(e, func(rec metricsdk.Record) error {
+		p, ok := toNumberPoint(rec)
+		if !ok {
+			return nil
+		}
+		points = append(points, p)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if len(points) == 0 {
+		return nil
+	}
+	return e.transport.exportMetrics(ctx, marshalMetricsRequest(points))
+}
+
+func toNumberPoint(rec metricsdk.Record) (otlpNumberPoint, bool) {
+	desc := rec.Descriptor()
+	p := otlpNumberPoint{
+		Name:        desc.Name(),
+		Description: desc.Description(),
+		Attributes:  rec.Labels().ToSlice(),
+		Start:       rec.StartTime(),
+		End:         rec.EndTime(),
+		IsFloat:     desc.NumberKind() == apimetric.Float64NumberKind,
+	}
+
+	switch agg := rec.Aggregation().(type) {
+	case aggregation.Sum:
+		sum, err := agg.Sum()
+		if err != nil {
+			return otlpNumberPoint{}, false
+		}
+		p.Sum = true
+		p.IsMonotonic = desc.MetricKind() == apimetric.CounterKind
+		setValue(&p, sum)
+		return p, true
+	case aggregation.LastValue:
+		last, t, err := agg.LastValue()
+		if err != nil {
+			return otlpNumberPoint{}, false
+		}
+		p.End = t
+		setValue(&p, last)
+		return p, true
+	default:
+		return otlpNumberPoint{}, false
+	}
+}
+
+func setValue(p *otlpNumberPoint, n apimetric.Number) {
+	if p.IsFloat {
+		p.ValueFloat = n.AsFloat64()
+	} else {
+		p.ValueInt = n.AsInt64()
+	}
+}
@@ -0,0 +1,271 @@
+package usvc
+
+import (
+	"math"
+	"time"
+
+	apitrace "go.opentelemetry.io/otel/api/trace"
+	"go.opentelemetry.io/otel/label"
+	export "go.opentelemetry.io/otel/sdk/export/trace"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+// marshalTraceRequest encodes spans as an OTLP ExportTraceServiceRequest.
+// It covers the fields every collector cares about (ids, name, kind,
+// timing, attributes, status) and skips events/links.
+func marshalTraceRequest(spans []*export.SpanData) []byte {
+	bySvc := map[string][]*export.SpanData{}
+	var order []string
+	for _, s := range spans {
+		name := s.InstrumentationLibrary.Name
+		if _, ok := bySvc[name]; !ok {
+			order = append(order, name)
+		}
+		bySvc[name] = append(bySvc[name], s)
+	}
+
+	var resourceSpans []byte
+	for _, name := range order {
+		group := bySvc[name]
+
+		var ilSpans []byte
+		for _, s := range group {
+			ilSpans = protowire.AppendTag(ilSpans, 2, protowire.BytesType)
+			ilSpans = protowire.AppendBytes(ilSpans, marshalSpan(s))
+		}
+
+		var il []byte
+		il = protowire.AppendTag(il, 1, protowire.BytesType)
+		il = protowire.AppendString(il, name)
+
+		var ilsMsg []byte
+		ilsMsg = protowire.AppendTag(ilsMsg, 1, protowire.BytesType)
+		ilsMsg = protowire.AppendBytes(ilsMsg, il)
+		ilsMsg = append(ilsMsg, ilSpans...)
+
+		var rs []byte
+		if len(group) > 0 {
+			rs = append(rs, marshalResource(group[0].Resource.Attributes())...)
+		}
+		rs = protowire.AppendTag(rs, 2, protowire.BytesType)
+		rs = protowire.AppendBytes(rs, ilsMsg)
+
+		resourceSpans = protowire.AppendTag(resourceSpans, 1, protowire.BytesType)
+		resourceSpans = protowire.AppendBytes(resourceSpans, rs)
+	}
+	return resourceSpans
+}
+
+func marshalResource(attrs []label.KeyValue) []byte {
+	var resource []byte
+	for _, kv := range attrs {
+		resource = protowire.AppendTag(resource, 1, protowire.BytesType)
+		resource = protowire.AppendBytes(resource, marshalKeyValue(kv))
+	}
+	if len(resource) == 0 {
+		return nil
+	}
+	var field []byte
+	field = protowire.AppendTag(field, 1, protowire.BytesType)
+	field = protowire.AppendBytes(field, resource)
+	return field
+}
+
+func marshalSpan(s *export.SpanData) []byte {
+	var b []byte
+
+	traceID := s.SpanContext.TraceID
+	b = protowire.AppendTag(b, 1, protowire.BytesType)
+	b = protowire.AppendBytes(b, traceID[:])
+
+	spanID := s.SpanContext.SpanID
+	b = protowire.AppendTag(b, 2, protowire.BytesType)
+	b = protowire.AppendBytes(b, spanID[:])
+
+	if s.ParentSpanID.IsValid() {
+		parentID := s.ParentSpanID
+		b = protowire.AppendTag(b, 4, protowire.BytesType)
+		b = protowire.AppendBytes(b, parentID[:])
+	}
+
+	b = protowire.AppendTag(b, 5, protowire.BytesType)
+	b = protowire.AppendString(b, s.Name)
+
+	b = protowire.AppendTag(b, 6, protowire.VarintType)
+	b = protowire.AppendVarint(b, uint64(spanKind(s.SpanKind)))
+
+	b = protowire.AppendTag(b, 7, protowire.Fixed64Type)
+	b = protowire.AppendFixed64(b, uint64(s.StartTime.UnixNano()))
+
+	b = protowire.AppendTag(b, 8, protowire.Fixed64Type)
+	b = protowire.AppendFixed64(b, uint64(s.EndTime.UnixNano()))
+
+	for _, kv := range s.Attributes {
+		b = protowire.AppendTag(b, 9, protowire.BytesType)
+		b = protowire.AppendBytes(b, marshalKeyValue(kv))
+	}
+
+	b = protowire.AppendTag(b, 15, protowire.BytesType)
+	b = protowire.AppendBytes(b, marshalStatus(s.StatusCode, s.StatusMessage))
+
+	return b
+}
+
+func marshalStatus(code codes.Code, message string) []byte {
+	var b []byte
+	b = protowire.AppendTag(b, 2, protowire.BytesType)
+	b = protowire.AppendString(b, message)
+	b = protowire.AppendTag(b, 3, protowire.VarintType)
+	b = protowire.AppendVarint(b, uint64(otlpStatusCode(code)))
+	return b
+}
+
+// otlpStatusCode maps a gRPC status code onto the OTLP Status.StatusCode
+// enum, which only defines UNSET(0)/OK(1)/ERROR(2) -- unlike spanKind's
+// ordinals, these don't line up, so codes.OK becomes OK and every other
+// gRPC code (all of which are errors) becomes ERROR.
+func otlpStatusCode(code codes.Code) int32 {
+	if code == codes.OK {
+		return 1 // STATUS_CODE_OK
+	}
+	return 2 // STATUS_CODE_ERROR
+}
+
+// spanKind maps the api/trace.SpanKind values onto the OTLP Span.SpanKind
+// enum; both happen to share the same INTERNAL..CONSUMER ordinals.
+func spanKind(k apitrace.SpanKind) int32 {
+	switch k {
+	case apitrace.SpanKindInternal, apitrace.SpanKindServer, apitrace.SpanKindClient,
+		apitrace.SpanKindProducer, apitrace.SpanKindConsumer:
+		return int32(k)
+	default:
+		return 0
+	}
+}
+
+func marshalKeyValue(kv label.KeyValue) []byte {
+	var b []byte
+	b = protowire.AppendTag(b, 1, protowire.BytesType)
+	b = protowire.AppendString(b, string(kv.Key))
+
+	var v []byte
+	switch kv.Value.Type() {
+	case label.BOOL:
+		v = protowire.AppendTag(v, 2, protowire.VarintType)
+		if kv.Value.AsBool() {
+			v = protowire.AppendVarint(v, 1)
+		} else {
+			v = protowire.AppendVarint(v, 0)
+		}
+	case label.INT64, label.UINT64:
+		v = protowire.AppendTag(v, 3, protowire.VarintType)
+		v = protowire.AppendVarint(v, uint64(kv.Value.AsInt64()))
+	case label.FLOAT64:
+		v = protowire.AppendTag(v, 4, protowire.Fixed64Type)
+		v = protowire.AppendFixed64(v, math.Float64bits(kv.Value.AsFloat64()))
+	default:
+		v = protowire.AppendTag(v, 1, protowire.BytesType)
+		v = protowire.AppendString(v, kv.Value.Emit())
+	}
+
+	b = protowire.AppendTag(b, 2, protowire.BytesType)
+	b = protowire.AppendBytes(b, v)
+	return b
+}
+
+// marshalMetricsRequest encodes a set of number metrics as an OTLP
+// ExportMetricsServiceRequest. Only Sum and LastValue aggregations are
+// supported; other aggregation kinds (histogram, summary, ...) are skipped.
+func marshalMetricsRequest(points []otlpNumberPoint) []byte {
+	if len(points) == 0 {
+		return nil
+	}
+
+	var ilMetrics []byte
+	for _, p := range points {
+		ilMetrics = protowire.AppendTag(ilMetrics, 2, protowire.BytesType)
+		ilMetrics = protowire.AppendBytes(ilMetrics, marshalMetric(p))
+	}
+
+	var rm []byte
+	rm = protowire.AppendTag(rm, 2, protowire.BytesType)
+	rm = protowire.AppendBytes(rm, ilMetrics)
+
+	var out []byte
+	out = protowire.AppendTag(out, 1, protowire.BytesType)
+	out = protowire.AppendBytes(out, rm)
+	return out
+}
+
+// otlpNumberPoint is a single exported number metric, already reduced from
+// the SDK's aggregation.Sum/LastValue interfaces.
+type otlpNumberPoint struct {
+	Name        string
+	Description string
+	IsMonotonic bool
+	Sum         bool // true: Metric.sum, false: Metric.gauge
+	Attributes  []label.KeyValue
+	Start, End  time.Time
+	ValueFloat  float64
+	ValueInt    int64
+	IsFloat     bool
+}
+
+func marshalMetric(p otlpNumberPoint) []byte {
+	var b []byte
+	b = protowire.AppendTag(b, 1, protowire.BytesType)
+	b = protowire.AppendString(b, p.Name)
+	if p.Description != "" {
+		b = protowire.AppendTag(b, 2, protowire.BytesType)
+		b = protowire.AppendString(b, p.Description)
+	}
+
+	dp := marshalNumberDataPoint(p)
+	var data []byte
+	if p.Sum {
+		var sum []byte
+		sum = protowire.AppendTag(sum, 1, protowire.BytesType)
+		sum = protowire.AppendBytes(sum, dp)
+		sum = protowire.AppendTag(sum, 2, protowire.VarintType)
+		sum = protowire.AppendVarint(sum, 2) // AGGREGATION_TEMPORALITY_CUMULATIVE
+		sum = protowire.AppendTag(sum, 3, protowire.VarintType)
+		if p.IsMonotonic {
+			sum = protowire.AppendVarint(sum, 1)
+		} else {
+			sum = protowire.AppendVarint(sum, 0)
+		}
+		data = protowire.AppendTag(data, 7, protowire.BytesType)
+		data = protowire.AppendBytes(data, sum)
+	} else {
+		var gauge []byte
+		gauge = protowire.AppendTag(gauge, 1, protowire.BytesType)
+		gauge = protowire.AppendBytes(gauge, dp)
+		data = protowire.AppendTag(data, 5, protowire.BytesType)
+		data = protowire.AppendBytes(data, gauge)
+	}
+	b = append(b, data...)
+	return b
+}
+
+func marshalNumberDataPoint(p otlpNumberPoint) []byte {
+	var b []byte
+	b = protowire.AppendTag(b, 2, protowire.Fixed64Type)
+	b = protowire.AppendFixed64(b, uint64(p.Start.UnixNano()))
+	b = protowire.AppendTag(b, 3, protowire.Fixed64Type)
+	b = protowire.AppendFixed64(b, uint64(p.End.UnixNano()))
+
+	if p.IsFloat {
+		b = protowire.AppendTag(b, 4, protowire.Fixed64Type)
+		b = protowire.AppendFixed64(b, math.Float64bits(p.ValueFloat))
+	} else {
+		b = protowire.AppendTag(b, 6, protowire.Fixed64Type)
+		b = protowire.AppendFixed64(b, uint64(p.ValueInt))
+	}
+
+	for _, kv := range p.Attributes {
+		b = protowire.AppendTag(b, 7, protowire.BytesType)
+		b = protowire.AppendBytes(b, marshalKeyValue(kv))
+	}
+	return b
+}
@@ -0,0 +1,99 @@
+package usvc
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"strconv"
+	"sync"
+	"syscall"
+)
+
+// USVCListenFDsEnv tells a re-exec'd child how many listening sockets its
+// parent handed down via os.ProcAttr.Files, starting at fd 3 (after the
+// standard stdin/stdout/stderr).
+const USVCListenFDsEnv = "USVC_LISTEN_FDS"
+
+const firstInheritedFD = 3
+
+var (
+	inheritedOnce      sync.Once
+	inheritedListeners []net.Listener
+)
+
+// inheritedListener returns the next fd passed down via USVC_LISTEN_FDS, or
+// nil if there isn't one: either this process wasn't started by a graceful
+// restart, or all inherited fds have already been claimed.
+func inheritedListener() net.Listener {
+	inheritedOnce.Do(func() {
+		n, _ := strconv.Atoi(os.Getenv(USVCListenFDsEnv))
+		for i := 0; i < n; i++ {
+			f := os.NewFile(uintptr(firstInheritedFD+i), fmt.Sprintf("usvc-inherited-%d", i))
+			lis, err := net.FileListener(f)
+			f.Close()
+			if err != nil {
+				continue
+			}
+			inheritedListeners = append(inheritedListeners, lis)
+		}
+	})
+	if len(inheritedListeners) == 0 {
+		return nil
+	}
+	lis := inheritedListeners[0]
+	inheritedListeners = inheritedListeners[1:]
+	return lis
+}
+
+// listen returns a listener for addr, adopting the next inherited fd from a
+// graceful restart instead of binding fresh if one is available.
+func listen(network, addr string) (net.Listener, error) {
+	if lis := inheritedListener(); lis != nil {
+		return lis, nil
+	}
+	return net.Listen(network, addr)
+}
+
+// isRestartSignal reports whether s is one of the signals that triggers a
+// graceful restart, as opposed to a plain shutdown.
+func isRestartSignal(s os.Signal) bool {
+	return s == syscall.SIGHUP || s == syscall.SIGUSR2
+}
+
+// restartProcess re-execs the running binary, handing each listener's fd
+// down to the child via os.ProcAttr.Files and USVC_LISTEN_FDS. The child is
+// expected to adopt them with listen/inheritedListener instead of binding
+// fresh; re-wrapping in TLS, if needed, is the caller's responsibility since
+// a bare fd carries no TLS state.
+func restartProcess(listeners ...net.Listener) (*os.Process, error) {
+	files := make([]*os.File, 0, len(listeners))
+	for _, lis := range listeners {
+		tl, ok := lis.(*net.TCPListener)
+		if !ok {
+			return nil, fmt.Errorf("usvc: graceful restart requires a TCP listener, got %T", lis)
+		}
+		f, err := tl.File()
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		files = append(files, f)
+	}
+
+	exe, err := os.Executable()
+	if err != nil {
+		return nil, err
+	}
+	env := append(os.Environ(), fmt.Sprintf("%s=%d", USVCListenFDsEnv, len(files)))
+	return os.StartProcess(exe, os.Args, &os.ProcAttr{
+		Env:   env,
+		Files: append([]*os.File{os.Stdin, os.Stdout, os.Stderr}, files...),
+	})
+}
+
+// writePIDFile writes the current process's pid to path, for orchestration
+// scripts that need to signal this process without tracking it themselves.
+func writePIDFile(path string) error {
+	return ioutil.WriteFile(path, []byte(strconv.Itoa(os.Getpid())), 0o644)
+}
@@ -1,21 +1,37 @@
 package usvc
 
 import (
+	"context"
 	"crypto/tls"
 	"log"
 	"net"
 	"net/http"
 	"os"
+	"os/signal"
 	"strings"
+	"syscall"
 	"time"
 
 	"github.com/rs/zerolog"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/reflection"
 )
 
 type Server struct {
-	Log *zerolog.Logger
-	Mux *http.ServeMux
-	Srv *http.Server
+	Log  *zerolog.Logger
+	Mux  *http.ServeMux
+	Srv  *http.Server
+	GRPC *grpc.Server
+
+	health          *health.Server
+	listener        net.Listener
+	shutdownTimeout time.Duration
+	gracefulRestart bool
+	pidFile         string
+	grpcCreds       credentials.TransportCredentials
 }
 
 func NewServer(cfg *Config) *Server {
@@ -50,26 +66,154 @@ func NewServer(cfg *Config) *Server {
 			MaxHeaderBytes:    cfg.MaxHeaderBytes,
 			ErrorLog:          log.New(lg, "", 0),
 		},
+		shutdownTimeout: cfg.ShutdownTimeout,
 	}
 }
 
+// Run binds s.Srv.Addr (or adopts a listener inherited via a graceful
+// restart) and serves until Shutdown is called. If s.GRPC was created (by
+// WithGRPCHealth, WithGRPCReflection, or WithMTLS), gRPC requests are
+// muxed onto the same listener alongside HTTP, the same dispatch-on-
+// Content-Type trick Conf.sharedServer uses -- otherwise the registered
+// gRPC services would never see a connection.
 func (s *Server) Run() error {
-	s.Log.Info().Str("addr", s.Srv.Addr).Msg("starting server")
-	return s.Srv.ListenAndServe()
+	lis, err := listen("tcp", s.Srv.Addr)
+	if err != nil {
+		return err
+	}
+	s.listener = lis
+	if s.Srv.TLSConfig != nil {
+		lis = tls.NewListener(lis, s.Srv.TLSConfig)
+	}
+
+	if s.GRPC != nil {
+		h := s.Srv.Handler
+		s.Srv.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.ProtoMajor == 2 && strings.HasPrefix(r.Header.Get("Content-Type"), "application/grpc") {
+				s.GRPC.ServeHTTP(w, r)
+			} else {
+				h.ServeHTTP(w, r)
+			}
+		})
+	}
+
+	if s.pidFile != "" {
+		if err := writePIDFile(s.pidFile); err != nil {
+			return err
+		}
+	}
+	if s.gracefulRestart {
+		go s.watchRestartSignals()
+	}
+
+	s.Log.Info().Str("addr", s.Srv.Addr).Bool("grpc", s.GRPC != nil).Msg("starting server")
+	return s.Srv.Serve(lis)
 }
 func (s *Server) Shutdown() error {
 	s.Log.Info().Msg("stopping server")
+	if s.GRPC != nil {
+		s.GRPC.GracefulStop()
+	}
 	return s.Srv.Shutdown(SignalContext())
 }
 
+// watchRestartSignals re-execs the process on SIGHUP/SIGUSR2, handing off
+// s.listener's fd to the child, then drains in-flight requests on the
+// current process bounded by s.shutdownTimeout.
+func (s *Server) watchRestartSignals() {
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, syscall.SIGHUP, syscall.SIGUSR2)
+	<-c
+
+	if _, err := restartProcess(s.listener); err != nil {
+		s.Log.Error().Err(err).Msg("graceful restart failed, keeping current process")
+		return
+	}
+	s.Log.Info().Msg("handed off listener to new process, draining")
+
+	ctx := context.Background()
+	if s.shutdownTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, s.shutdownTimeout)
+		defer cancel()
+	}
+	if s.GRPC != nil {
+		if s.shutdownTimeout > 0 {
+			t := time.AfterFunc(s.shutdownTimeout, s.GRPC.Stop)
+			defer t.Stop()
+		}
+		s.GRPC.GracefulStop()
+	}
+	if err := s.Srv.Shutdown(ctx); err != nil {
+		s.Log.Error().Err(err).Msg("error draining connections during graceful restart")
+	}
+}
+
 type ServerOption func(*Server)
 
-func WithLiveliness(p string) ServerOption {
+// WithHealth mounts /livez and /readyz backed by h. If WithGRPCHealth is
+// also used, apply it first: WithHealth wires h's readiness aggregate to
+// the registered gRPC health service's "" service status.
+func WithHealth(h *Health) ServerOption {
 	return func(s *Server) {
-		s.Mux.HandleFunc(p, func(w http.ResponseWriter, r *http.Request) {
-			w.WriteHeader(http.StatusOK)
-		})
+		s.Mux.HandleFunc("/livez", h.livezHandler())
+		s.Mux.HandleFunc("/readyz", h.readyzHandler())
+		if s.health != nil {
+			h.SetGRPCHealth(s.health, "")
+		}
+	}
+}
+
+// ensureGRPC creates s.GRPC if it hasn't been already, picking up
+// credentials set by an earlier WithMTLS and wiring in the same default
+// interceptor chain (metrics, tracing, recovery) as Conf.Server's grpcMid,
+// so options like WithGRPCHealth, WithGRPCReflection, and WithMTLS get
+// observability whichever of them creates s.GRPC first.
+func ensureGRPC(s *Server) {
+	if s.GRPC != nil {
+		return
+	}
+	var credOpts []grpc.ServerOption
+	var extra []grpc.UnaryServerInterceptor
+	if s.grpcCreds != nil {
+		credOpts = append(credOpts, grpc.Creds(s.grpcCreds))
+		extra = append(extra, mtlsUnaryInterceptor())
+	}
+	opts := append(credOpts, grpcMid(*s.Log, extra...)...)
+	s.GRPC = grpc.NewServer(opts...)
+}
+
+// WithGRPCHealth registers the standard grpc.health.v1.Health service,
+// creating s.GRPC if it hasn't been already (picking up credentials set by
+// an earlier WithMTLS). Use Server.SetServingStatus to update status, e.g.
+// to NOT_SERVING before GracefulStop during shutdown.
+func WithGRPCHealth() ServerOption {
+	return func(s *Server) {
+		ensureGRPC(s)
+		s.health = health.NewServer()
+		healthpb.RegisterHealthServer(s.GRPC, s.health)
+	}
+}
+
+// WithGRPCReflection registers the grpc.reflection.v1alpha service,
+// creating s.GRPC if it hasn't been already. It lets tools like grpcurl
+// list and call methods without a local copy of the .proto files; meant
+// for development, leave it off in prod where exposing the full
+// service/method list isn't desirable.
+func WithGRPCReflection() ServerOption {
+	return func(s *Server) {
+		ensureGRPC(s)
+		reflection.Register(s.GRPC)
+	}
+}
+
+// SetServingStatus updates the status reported by the gRPC health service
+// registered via WithGRPCHealth. It is a no-op if WithGRPCHealth wasn't used.
+func (s *Server) SetServingStatus(service string, status healthpb.HealthCheckResponse_ServingStatus) {
+	if s.health == nil {
+		return
 	}
+	s.health.SetServingStatus(service, status)
 }
 
 func WithTLSConfig(c *tls.Config) ServerOption {
@@ -134,3 +278,25 @@ func WithCORS(allowedMethods []string, allowedSuffix []string) ServerOption {
 		})
 	}
 }
+
+// WithGracefulRestart enables zero-downtime restarts: on SIGHUP or SIGUSR2,
+// Run re-execs the binary, passing its listening socket down to the child
+// via USVC_LISTEN_FDS, then drains in-flight requests on the current
+// process (bounded by Config.ShutdownTimeout). Run returns
+// http.ErrServerClosed as soon as the HTTP drain begins; it does not wait
+// for that drain to finish. The child
+// adopts the inherited fd automatically the next time Run is called.
+func WithGracefulRestart() ServerOption {
+	return func(s *Server) {
+		s.gracefulRestart = true
+	}
+}
+
+// WithPIDFile writes the process's pid to path when Run starts, so
+// orchestration scripts can signal it for a graceful restart without
+// tracking the pid themselves.
+func WithPIDFile(path string) ServerOption {
+	return func(s *Server) {
+		s.pidFile = path
+	}
+}
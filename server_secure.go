@@ -17,7 +17,7 @@ func NewServerSecure(c *Config, certFile, keyFile string) (*ServerSecure, error)
 	s := &ServerSecure{
 		NewServer(c),
 	}
-	WithLiveliness("/health")(s.Server)
+	WithHealth(NewHealth(0))(s.Server)
 	WithTLS(cert)(s.Server)
 	WithCORS([]string{http.MethodOptions, http.MethodGet}, []string{"*"})(s.Server)
 	return s, nil
@@ -8,6 +8,6 @@ func NewServiceSimple(c *Config) *ServerSimple {
 	s := &ServerSimple{
 		NewServer(c),
 	}
-	WithLiveliness("/health")(s.Server)
+	WithHealth(NewHealth(0))(s.Server)
 	return s
 }
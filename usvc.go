@@ -5,6 +5,7 @@ import (
 	"crypto/tls"
 	"errors"
 	"flag"
+	"fmt"
 	"io"
 	"net"
 	"net/http"
@@ -23,6 +24,9 @@ import (
 	"golang.org/x/sync/errgroup"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/reflection"
 )
 
 type FlagRegisterer interface {
@@ -37,6 +41,39 @@ type Conf struct {
 	TLSKeyFile  string
 	LogLevel    string
 	LogFormat   string
+
+	// Health backs /livez and /readyz. Register checks on it before
+	// calling Server; if nil, Server uses an empty registry that always passes.
+	Health *Health
+
+	// GracefulRestart enables zero-downtime restarts on SIGHUP/SIGUSR2 for
+	// the shared HTTP+gRPC listener (GRPCAddr == HTTPAddr). Server returns
+	// an error if it's set with GRPCAddr and HTTPAddr split across two
+	// listeners, since handing off both fds in lockstep from two
+	// independent signal-watching goroutines isn't supported.
+	GracefulRestart bool
+	// PIDFile, if set, is written with the process's pid when Server starts.
+	PIDFile string
+	// ShutdownTimeout bounds how long Server waits for in-flight requests
+	// to finish during a graceful restart or shutdown. Zero waits forever.
+	// With GRPCAddr and HTTPAddr on separate listeners it bounds only the
+	// HTTP side; the gRPC listener's GracefulStop waits for every RPC.
+	ShutdownTimeout time.Duration
+
+	// TLSClientCAFile, if set, enables mTLS: it names a PEM file of CAs
+	// trusted to verify client certificates, applied to both the HTTP and
+	// gRPC listeners.
+	TLSClientCAFile string
+	// TLSClientAuth selects how strictly a client must present a
+	// certificate: none, request, require, or verify. Only takes effect
+	// alongside TLSClientCAFile.
+	TLSClientAuth string
+
+	// GRPCReflection registers the grpc.reflection.v1alpha service so
+	// tools like grpcurl can list and call methods without a local copy
+	// of the .proto files. Meant for development; leave it off in prod,
+	// where exposing the full service/method list isn't desirable.
+	GRPCReflection bool
 }
 
 // DefaultConf uses a new flagset and os.Args,
@@ -62,6 +99,12 @@ func (c *Conf) RegisterFlags(fs *flag.FlagSet) {
 	fs.StringVar(&c.TLSKeyFile, "tls.key", "", "tls key file")
 	fs.StringVar(&c.LogLevel, "log.level", "", "logging level: debug, info, warn, error")
 	fs.StringVar(&c.LogFormat, "log.format", "", "format: logfmt, json")
+	fs.BoolVar(&c.GracefulRestart, "restart.graceful", false, "re-exec on SIGHUP/SIGUSR2 instead of exiting, handing off listening sockets")
+	fs.StringVar(&c.PIDFile, "restart.pidfile", "", "write the process pid to this file")
+	fs.DurationVar(&c.ShutdownTimeout, "shutdown.timeout", 10*time.Second, "max time to wait for in-flight requests to finish during shutdown")
+	fs.StringVar(&c.TLSClientCAFile, "tls.client-ca", "", "PEM file of CAs trusted to verify client certificates, enables mTLS")
+	fs.StringVar(&c.TLSClientAuth, "tls.client-auth", "none", "client certificate requirement: none, request, require, verify")
+	fs.BoolVar(&c.GRPCReflection, "grpc.reflection", false, "register the grpc reflection service, for use with grpcurl and similar tools")
 }
 
 // Logger returns a configured logger
@@ -94,42 +137,88 @@ func (c Conf) Server(m *http.ServeMux) (*http.Server, *grpc.Server, Runner, erro
 		m = http.NewServeMux()
 	}
 
+	if c.PIDFile != "" {
+		if err := writePIDFile(c.PIDFile); err != nil {
+			return nil, nil, nil, err
+		}
+	}
+
 	m.HandleFunc("/debug/pprof/", pprof.Index)
 	m.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
 	m.HandleFunc("/debug/pprof/profile", pprof.Profile)
 	m.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
 	m.HandleFunc("/debug/pprof/trace", pprof.Trace)
 	m.Handle("/health", healthOK)
+	if c.Health == nil {
+		c.Health = NewHealth(0)
+	}
+	m.HandleFunc("/livez", c.Health.livezHandler())
+	m.HandleFunc("/readyz", c.Health.readyzHandler())
+	// This otel Prometheus exporter version has a single global histogram
+	// boundary set, shared by every ValueRecorder -- request_latency_ms
+	// (milliseconds) and grpcMid's grpc_server_handled_seconds (seconds)
+	// alike -- so the list below spans both scales rather than being
+	// tuned to just one of them.
 	promExporter, _ := prometheus.InstallNewPipeline(prometheus.Config{
-		DefaultHistogramBoundaries: []float64{1, 5, 10, 50, 100},
+		DefaultHistogramBoundaries: []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10, 25, 50, 100, 250, 500, 1000, 2500, 5000, 10000},
 	})
 	m.Handle("/metrics", promExporter)
 
 	// http
 	h := httpMid(m, c.Logger(), latency)
 	h = corsAllowAll(h)
+	h = mtlsMiddleware(h)
 
 	// grpc
 	var grpctls bool
 	var opts []grpc.ServerOption
+	var mtlsInterceptors []grpc.UnaryServerInterceptor
 	if c.TLSKeyFile != "" {
-		creds, err := credentials.NewServerTLSFromFile(c.TLSCertFile, c.TLSKeyFile)
+		cert, err := tls.LoadX509KeyPair(c.TLSCertFile, c.TLSKeyFile)
 		if err != nil {
 			return nil, nil, nil, err
 		}
-		opts = append(opts, grpc.Creds(creds))
+		tlsConf := &tls.Config{Certificates: []tls.Certificate{cert}}
+		if c.TLSClientCAFile != "" {
+			pool, err := loadCertPool(c.TLSClientCAFile)
+			if err != nil {
+				return nil, nil, nil, err
+			}
+			clientAuth, err := parseClientAuthType(c.TLSClientAuth)
+			if err != nil {
+				return nil, nil, nil, err
+			}
+			tlsConf.ClientCAs = pool
+			tlsConf.ClientAuth = clientAuth
+			mtlsInterceptors = append(mtlsInterceptors, mtlsUnaryInterceptor())
+		}
+		opts = append(opts, grpc.Creds(credentials.NewTLS(tlsConf)))
 		grpctls = true
 	}
-	opts = append(opts, grpcMid(c.Logger(), latency))
+	opts = append(opts, grpcMid(c.Logger(), mtlsInterceptors...)...)
 	grpcServer := grpc.NewServer(opts...)
+	if c.GRPCReflection {
+		reflection.Register(grpcServer)
+	}
+
+	healthServer := health.NewServer()
+	healthpb.RegisterHealthServer(grpcServer, healthServer)
+	c.Health.SetGRPCHealth(healthServer, "")
 
 	// share
 	if c.GRPCAddr == c.HTTPAddr {
-		httpServer, run, err := c.sharedServer(h, grpcServer)
+		httpServer, run, err := c.sharedServer(h, grpcServer, healthServer)
 		return httpServer, grpcServer, run, err
 	}
 
-	// separate
+	// separate: HTTP and gRPC each own a distinct listener, and handing off
+	// both fds in lockstep from two independent signal-watching goroutines
+	// isn't supported, so reject this combination up front instead of
+	// silently ignoring GracefulRestart.
+	if c.GracefulRestart {
+		return nil, nil, nil, fmt.Errorf("usvc: restart.graceful requires grpc.addr == http.addr, got %q and %q", c.GRPCAddr, c.HTTPAddr)
+	}
+
 	grpcRun := func(ctx context.Context) error {
 		go func() {
 			c := make(chan os.Signal, 1)
@@ -138,6 +227,7 @@ func (c Conf) Server(m *http.ServeMux) (*http.Server, *grpc.Server, Runner, erro
 			case <-c:
 			case <-ctx.Done():
 			}
+			healthServer.Shutdown()
 			grpcServer.GracefulStop()
 		}()
 
@@ -150,7 +240,7 @@ func (c Conf) Server(m *http.ServeMux) (*http.Server, *grpc.Server, Runner, erro
 		lg.Info().Str("grpc-addr", c.GRPCAddr).Bool("tls", grpctls).Msg("started grpc server")
 		return grpcServer.Serve(lis)
 	}
-	httpServer, httpRun, err := c.sharedServer(h, nil)
+	httpServer, httpRun, err := c.sharedServer(h, nil, nil)
 	if err != nil {
 		return nil, nil, nil, err
 	}
@@ -165,7 +255,7 @@ func (c Conf) Server(m *http.ServeMux) (*http.Server, *grpc.Server, Runner, erro
 
 }
 
-func (c Conf) sharedServer(h http.Handler, grpcServer *grpc.Server) (*http.Server, Runner, error) {
+func (c Conf) sharedServer(h http.Handler, grpcServer *grpc.Server, healthServer *health.Server) (*http.Server, Runner, error) {
 	var dispatch http.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if r.ProtoMajor == 2 && strings.HasPrefix(r.Header.Get("Content-Type"), "application/grpc") {
 			grpcServer.ServeHTTP(w, r)
@@ -187,27 +277,77 @@ func (c Conf) sharedServer(h http.Handler, grpcServer *grpc.Server) (*http.Serve
 			MinVersion: tls.VersionTLS13,
 		},
 	}
+	if c.TLSClientCAFile != "" {
+		pool, err := loadCertPool(c.TLSClientCAFile)
+		if err != nil {
+			return nil, nil, err
+		}
+		clientAuth, err := parseClientAuthType(c.TLSClientAuth)
+		if err != nil {
+			return nil, nil, err
+		}
+		srv.TLSConfig.ClientCAs = pool
+		srv.TLSConfig.ClientAuth = clientAuth
+	}
+
+	lis, err := listen("tcp", c.HTTPAddr)
+	if err != nil {
+		return nil, nil, err
+	}
 
 	run := func(ctx context.Context) error {
 		se := make(chan error)
 
 		go func() {
-			c := make(chan os.Signal, 1)
-			signal.Notify(c, syscall.SIGINT, syscall.SIGTERM)
-			select {
-			case <-c:
-			case <-ctx.Done():
+			sig := make(chan os.Signal, 1)
+			sigs := []os.Signal{syscall.SIGINT, syscall.SIGTERM}
+			// GracefulRestart hands off this listener's single fd, which
+			// also covers grpcServer since it's muxed over the same port.
+			if c.GracefulRestart && grpcServer != nil {
+				sigs = append(sigs, syscall.SIGHUP, syscall.SIGUSR2)
+			}
+			signal.Notify(sig, sigs...)
+
+			for {
+				var s os.Signal
+				select {
+				case s = <-sig:
+				case <-ctx.Done():
+				}
+				if s == nil || !isRestartSignal(s) {
+					break
+				}
+				_, err := restartProcess(lis)
+				if err == nil {
+					break
+				}
+				lg := c.Logger()
+				lg.Error().Err(err).Msg("graceful restart failed, keeping current process")
+			}
+
+			shutdownCtx := context.Background()
+			if c.ShutdownTimeout > 0 {
+				var cancel context.CancelFunc
+				shutdownCtx, cancel = context.WithTimeout(shutdownCtx, c.ShutdownTimeout)
+				defer cancel()
 			}
 
 			// call shutdown and wait for both
 			gc := make(chan struct{})
 			if grpcServer != nil {
 				go func() {
+					if healthServer != nil {
+						healthServer.Shutdown()
+					}
+					if c.ShutdownTimeout > 0 {
+						t := time.AfterFunc(c.ShutdownTimeout, grpcServer.Stop)
+						defer t.Stop()
+					}
 					grpcServer.GracefulStop()
 					close(gc)
 				}()
 			}
-			err := srv.Shutdown(context.Background())
+			err := srv.Shutdown(shutdownCtx)
 			if grpcServer != nil {
 				<-gc
 			}
@@ -219,10 +359,10 @@ func (c Conf) sharedServer(h http.Handler, grpcServer *grpc.Server) (*http.Serve
 		var err error
 		if c.TLSKeyFile != "" {
 			lg.Info().Str("http-addr", c.HTTPAddr).Bool("tls", true).Msg("started http server")
-			err = srv.ListenAndServeTLS(c.TLSCertFile, c.TLSKeyFile)
+			err = srv.ServeTLS(lis, c.TLSCertFile, c.TLSKeyFile)
 		} else {
 			lg.Info().Str("http-addr", c.HTTPAddr).Bool("tls", false).Msg("started http server")
-			err = srv.ListenAndServe()
+			err = srv.Serve(lis)
 		}
 		if errors.Is(err, http.ErrServerClosed) {
 			return <-se